@@ -1,151 +1,56 @@
 package oncall
 
-import (
-	"sort"
-	"sync"
-	"time"
-)
+import "time"
 
-var (
-	activeCalcValuePool = &sync.Pool{
-		New: func() interface{} { return make([]activeCalcValue, 0, 100) },
-	}
-)
-
-// ActiveCalculator will calculate if the current timestamp is within a span.
+// ActiveCalculator will calculate if the current timestamp is within one or more spans.
+//
+// It is the zero-payload specialization of SpanCalculator: every span shares
+// the single implicit value struct{}{}, so Active() reports whether that
+// value currently has an open span rather than callers needing to track a
+// value of their own.
 type ActiveCalculator struct {
-	*TimeIterator
-
-	states []activeCalcValue
-
-	init    bool
-	active  activeCalcValue
-	changed bool
-}
-type activeCalcValue struct {
-	T       int64
-	IsStart bool
-
-	// OriginalT is the original time of this value (e.g., historic start time vs. start of calculation).
-	OriginalT int64
+	*SpanCalculator[struct{}]
 }
 
 // NewActiveCalculator will create a new ActiveCalculator bound to the TimeIterator.
 func (t *TimeIterator) NewActiveCalculator() *ActiveCalculator {
-	act := &ActiveCalculator{
-		TimeIterator: t,
-		states:       activeCalcValuePool.Get().([]activeCalcValue),
-	}
-	t.Register(act)
-
-	return act
-}
-
-// Init should be called after all SetSpan calls have been completed and before Next().
-func (act *ActiveCalculator) Init() *ActiveCalculator {
-	if act.init {
-		return act
-	}
-	act.init = true
-
-	sort.Slice(act.states, func(i, j int) bool { return act.states[i].T < act.states[j].T })
-
-	return act
+	return &ActiveCalculator{SpanCalculator: newSpanCalculator[struct{}](t)}
 }
 
 // SetSpan is used to set an active span.
 //
-// Care should be taken so that there is no overlap between spans, and
-// no start time should equal any end time for non-sequential calls.
+// Spans may overlap, including with spans added by earlier SetSpan calls; the
+// calculator is active for as long as at least one span is open.
 func (act *ActiveCalculator) SetSpan(start, end time.Time) {
-	if act.init {
-		panic("cannot add spans after Init")
-	}
-
-	// Skip if the span ends before the iterator start time.
-	//
-	// A zero end time indicates infinity (e.g. current shift from history).
-	if !end.After(act.Start()) && !end.IsZero() {
-		return
-	}
-
-	// Skip if the length of the span is <= 0.
-	if !end.IsZero() && !end.After(start) {
-		return
-	}
-
-	// Skip if the span starts after the calculator end time.
-	if !start.Before(act.End()) {
-		return
-	}
-
-	act.set(start, true)
-	if !end.IsZero() {
-		act.set(end, false)
-	}
+	act.SpanCalculator.SetSpan(start, end, struct{}{})
 }
 
-func (act *ActiveCalculator) set(t time.Time, isStart bool) {
-	id := t.Truncate(act.Step()).Unix()
-	originalID := id
-	if isStart && t.Before(act.Start()) {
-		id = act.Start().Unix()
-	}
-
-	if len(act.states) > 0 && isStart && id == act.states[len(act.states)-1].T {
-		act.states = act.states[:len(act.states)-1]
-		return
-	}
-
-	act.states = append(act.states, activeCalcValue{T: id, IsStart: isStart, OriginalT: originalID})
+// AppendSpan inserts a new active span after Init; see
+// SpanCalculator.AppendSpan for the streaming-ingestion semantics.
+func (act *ActiveCalculator) AppendSpan(start, end time.Time) error {
+	return act.SpanCalculator.AppendSpan(start, end, struct{}{})
 }
 
-// Process implements the SubIterator.Process method.
-func (act *ActiveCalculator) Process(t int64) int64 {
-	if !act.init {
-		panic("Init never called")
-	}
-	if len(act.states) == 0 {
-		act.changed = false
-		return -1
-	}
-
-	val := act.states[0]
-	act.changed = val.T == t
-	if act.changed {
-		act.active = val
-		act.states = act.states[1:]
-		if len(act.states) > 0 {
-			return act.states[0].T
-		}
-
-		return -1
-	}
+// Active will return true if the current timestamp is within at least one span.
+func (act *ActiveCalculator) Active() bool { return act.depth[struct{}{}] > 0 }
 
-	return val.T
-}
-
-// Done implements the SubIterator.Done method.
-func (act *ActiveCalculator) Done() {
-	//lint:ignore SA6002 not worth the overhead to avoid the slice-struct allocation
-	activeCalcValuePool.Put(act.states[:0])
-
-	act.states = nil
-}
-
-// Active will return true if the current timestamp is within a span.
-func (act *ActiveCalculator) Active() bool { return act.active.IsStart }
-
-// Changed will return true if the current tick changed the Active() state.
-func (act *ActiveCalculator) Changed() bool { return act.changed }
-
-// ActiveTime returns the original start time of the current Active() state.
+// ActiveTime returns the original start time of the earliest still-open span.
 //
 // If Active() is false, it returns a zero value.
 func (act *ActiveCalculator) ActiveTime() time.Time {
-	if !act.Active() {
-		return time.Time{}
+	return act.SpanCalculator.ActiveTime(struct{}{})
+}
+
+// IsActiveAt returns whether the calculator was active at t, and if so, the
+// original start time of the earliest still-open span.
+//
+// It is a random-access point query against the (already Init'd) event
+// stream -- useful for something like "who is on call right now" without
+// needing to step a TimeIterator up to that point.
+func (act *ActiveCalculator) IsActiveAt(t time.Time) (active bool, spanStart time.Time) {
+	if len(act.ActiveValuesAt(t)) == 0 {
+		return false, time.Time{}
 	}
 
-	return time.Unix(act.active.OriginalT, 0).UTC()
+	return true, act.ActiveTimeAt(t, struct{}{})
 }
@@ -0,0 +1,189 @@
+package oncall_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/target/goalert/oncall"
+)
+
+// TestActiveCalculator_SetSpan_Boundaries covers the half-open [Start, End)
+// window semantics at every combination of span boundary vs. iterator
+// boundary vs. step boundary.
+func TestActiveCalculator_SetSpan_Boundaries(t *testing.T) {
+	type result struct {
+		Time   time.Time
+		Active bool
+	}
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 10, 0, 0, time.UTC)
+	)
+	check := func(desc string, expected []result, setup func(*oncall.ActiveCalculator)) {
+		t.Run(desc, func(t *testing.T) {
+			iter := oncall.NewTimeIterator(
+				start,
+				end,
+				time.Minute,
+			).NewActiveCalculator()
+
+			setup(iter)
+			iter.Init()
+
+			var results []result
+			for iter.Next() {
+				results = append(results, result{
+					Time:   time.Unix(iter.Unix(), 0).UTC(),
+					Active: iter.Active(),
+				})
+			}
+
+			assert.EqualValues(t, expected, results)
+		})
+	}
+
+	check("span at exactly Start()",
+		[]result{
+			{Time: start, Active: true},
+			{Time: start.Add(2 * time.Minute), Active: false},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(start, start.Add(2*time.Minute))
+		},
+	)
+
+	check("span at exactly End() is dropped (start >= End())",
+		[]result{
+			{Time: start, Active: false},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(end, end.Add(2*time.Minute))
+		},
+	)
+
+	check("span ending at exactly Start() is dropped (end <= Start())",
+		[]result{
+			{Time: start, Active: false},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(start.Add(-2*time.Minute), start)
+		},
+	)
+
+	check("span crossing Start() mid-step is clamped to Start()",
+		[]result{
+			{Time: start, Active: true},
+			{Time: start.Add(time.Minute), Active: false},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(start.Add(-30*time.Second), start.Add(time.Minute))
+		},
+	)
+
+	check("span crossing End() is clamped to End()",
+		[]result{
+			{Time: start, Active: false},
+			{Time: end.Add(-2 * time.Minute), Active: true},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(end.Add(-2*time.Minute), end.Add(2*time.Minute))
+		},
+	)
+
+	check("zero-length span is a no-op",
+		[]result{
+			{Time: start, Active: false},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(start.Add(5*time.Minute), start.Add(5*time.Minute))
+		},
+	)
+
+	check("open-ended span (end.IsZero()) is clipped to End()",
+		[]result{
+			{Time: start, Active: false},
+			{Time: end.Add(-2 * time.Minute), Active: true},
+			{Time: end, Active: false},
+		},
+		func(act *oncall.ActiveCalculator) {
+			act.SetSpan(end.Add(-2*time.Minute), time.Time{})
+		},
+	)
+}
+
+// TestActiveCalculator_AppendSpan covers inserting spans after Init, for the
+// streaming-ingestion use case.
+//
+// TimeIterator only ticks at times a registered sub-iterator actually cares
+// about (plus Start() and End()), so with a single one-minute span there are
+// only 3 ticks: Start() (span opens), Start()+1m (span closes), and End()
+// (nothing left pending, so the iterator jumps straight there).
+func TestActiveCalculator_AppendSpan(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 10, 0, 0, time.UTC)
+	)
+	act := oncall.NewTimeIterator(start, end, time.Minute).NewActiveCalculator()
+	act.SetSpan(start, start.Add(time.Minute))
+	act.Init()
+
+	// Step up to the span's close tick before appending, to simulate a live
+	// "tail" use case where later spans are discovered as iteration
+	// proceeds.
+	assert.True(t, act.Next())
+	assert.Equal(t, start.Unix(), act.Unix())
+	assert.True(t, act.Next())
+	assert.Equal(t, start.Add(time.Minute).Unix(), act.Unix())
+
+	err := act.AppendSpan(start, start.Add(2*time.Minute))
+	assert.Error(t, err, "span at/before the current position should be rejected")
+
+	err = act.AppendSpan(start.Add(5*time.Minute), start.Add(6*time.Minute))
+	assert.NoError(t, err)
+
+	var results []bool
+	for act.Next() {
+		results = append(results, act.Active())
+	}
+	assert.EqualValues(t, []bool{true, false, false}, results)
+}
+
+// TestActiveCalculator_IsActiveAt covers point queries issued before
+// iteration starts, mid-iteration, and for an already-consumed past tick --
+// IsActiveAt must stay correct throughout, independent of how far Process
+// has advanced.
+func TestActiveCalculator_IsActiveAt(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 10, 0, 0, time.UTC)
+	)
+	act := oncall.NewTimeIterator(start, end, time.Minute).NewActiveCalculator()
+	act.SetSpan(start.Add(time.Minute), start.Add(2*time.Minute))
+	act.SetSpan(start.Add(3*time.Minute), start.Add(4*time.Minute))
+	act.Init()
+
+	future := start.Add(3*time.Minute + 30*time.Second)
+	past := start.Add(time.Minute + 30*time.Second)
+
+	active, spanStart := act.IsActiveAt(future)
+	assert.True(t, active, "before any Next()")
+	assert.Equal(t, start.Add(3*time.Minute).Unix(), spanStart.Unix())
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, act.Next())
+	}
+
+	active, spanStart = act.IsActiveAt(future)
+	assert.True(t, active, "mid-iteration, query still ahead of the current tick")
+	assert.Equal(t, start.Add(3*time.Minute).Unix(), spanStart.Unix())
+
+	active, _ = act.IsActiveAt(past)
+	assert.True(t, active, "mid-iteration, query into the already-consumed past")
+}
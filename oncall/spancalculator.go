@@ -0,0 +1,521 @@
+package oncall
+
+import (
+	"container/heap"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SpanCalculator tracks, for each distinct value of T, whether it has an open
+// span (start <= now < end) at the current iterator tick.
+//
+// Internally it is a reference-counted event stream: each SetSpan call emits
+// a +1 event at its start and a -1 event at its end, keyed by value, and a
+// running per-value depth determines whether that value is currently active.
+// Spans may overlap freely, including multiple spans for the same value.
+type SpanCalculator[T comparable] struct {
+	*TimeIterator
+
+	// states is sorted by T and, once Init has run, never loses events:
+	// Process advances through it via pos rather than reslicing it, and
+	// AppendSpan only inserts events later than the current position, so
+	// that it stays a stable, complete history for
+	// ActiveValuesAt/ActiveTimeAt to binary-search regardless of how far
+	// Process has consumed.
+	states []spanEvent[T]
+	pos    int
+
+	init    bool
+	depth   map[T]int
+	starts  map[T]*valueHeap
+	active  []T
+	changed bool
+
+	// snapshots is parallel to states, giving the active-value snapshot
+	// after processing states[i]. It is (re)computed whenever states
+	// changes -- by Init, and by AppendSpan -- so that ActiveValuesAt and
+	// ActiveTimeAt can binary-search into it instead of replaying the whole
+	// event stream on every call. Because states is stable (see above),
+	// this stays correct for queries into the past, present, or future
+	// regardless of how far Process has advanced.
+	snapshots []spanSnapshot[T]
+
+	// snapDepth/snapStarts/snapActive mirror depth/starts/active above, but
+	// are advanced independently through snapshots -- kept around so that
+	// AppendSpan can extend snapshots for newly appended events in O(1)
+	// amortized instead of rebuilding the whole array from scratch.
+	snapDepth  map[T]int
+	snapStarts map[T]*valueHeap
+	snapActive []T
+}
+
+// spanSnapshot is a point-in-time snapshot of which values are active and
+// the earliest still-open start time for each.
+type spanSnapshot[T comparable] struct {
+	active   []T
+	earliest map[T]int64
+}
+
+// spanEvent is a single +1/-1 event in a SpanCalculator's depth stream.
+type spanEvent[T comparable] struct {
+	T     int64
+	Delta int
+	Value T
+
+	// OriginalT is the original (un-clamped, but truncated to Step()) start
+	// time of the span this event belongs to. It is carried on both the start and end
+	// event of a span so the end event can retire the right entry from
+	// starts.
+	OriginalT int64
+}
+
+var (
+	// spanEventPools and activeValuePools hold one *sync.Pool per
+	// instantiated T, since a plain generic package-level var can't itself
+	// be parameterized by T. This preserves the pooled-slice fast path the
+	// single-type ActiveCalculator/UserCalculator used to have directly.
+	spanEventPools   sync.Map // map[reflect.Type]*sync.Pool, of []spanEvent[T]
+	activeValuePools sync.Map // map[reflect.Type]*sync.Pool, of []T
+)
+
+func spanEventPool[T comparable]() *sync.Pool {
+	key := reflect.TypeOf((*T)(nil)).Elem()
+	if p, ok := spanEventPools.Load(key); ok {
+		return p.(*sync.Pool)
+	}
+
+	p, _ := spanEventPools.LoadOrStore(key, &sync.Pool{
+		New: func() interface{} { return make([]spanEvent[T], 0, 100) },
+	})
+	return p.(*sync.Pool)
+}
+
+func activeValuePool[T comparable]() *sync.Pool {
+	key := reflect.TypeOf((*T)(nil)).Elem()
+	if p, ok := activeValuePools.Load(key); ok {
+		return p.(*sync.Pool)
+	}
+
+	p, _ := activeValuePools.LoadOrStore(key, &sync.Pool{
+		New: func() interface{} { return make([]T, 0, 10) },
+	})
+	return p.(*sync.Pool)
+}
+
+func newSpanCalculator[T comparable](t *TimeIterator) *SpanCalculator[T] {
+	s := &SpanCalculator[T]{
+		TimeIterator: t,
+		states:       spanEventPool[T]().Get().([]spanEvent[T]),
+		depth:        make(map[T]int),
+		starts:       make(map[T]*valueHeap),
+		active:       activeValuePool[T]().Get().([]T)[:0],
+	}
+	t.Register(s)
+
+	return s
+}
+
+// Init should be called after all SetSpan calls have been completed and before Next().
+func (s *SpanCalculator[T]) Init() *SpanCalculator[T] {
+	if s.init {
+		return s
+	}
+	s.init = true
+
+	sort.SliceStable(s.states, func(i, j int) bool { return s.states[i].T < s.states[j].T })
+	s.rebuildSnapshots()
+
+	return s
+}
+
+// rebuildSnapshots recomputes snapshots from scratch against the full
+// (sorted) states. It is O(n) in the number of events; Init always pays it
+// once, and AppendSpan only falls back to it for the rare out-of-order
+// append -- see extendSnapshots for the common case.
+func (s *SpanCalculator[T]) rebuildSnapshots() {
+	s.snapshots = s.snapshots[:0]
+	s.snapDepth = make(map[T]int)
+	s.snapStarts = make(map[T]*valueHeap)
+	s.snapActive = nil
+
+	s.extendSnapshots(0)
+}
+
+// extendSnapshots appends a snapshot entry for each of states[from:],
+// continuing from the existing snapDepth/snapStarts/snapActive state. The
+// caller must ensure from == len(s.snapshots), i.e. that it's a contiguous
+// extension.
+func (s *SpanCalculator[T]) extendSnapshots(from int) {
+	for _, val := range s.states[from:] {
+		wasActive := s.snapDepth[val.Value] > 0
+		s.snapDepth[val.Value] += val.Delta
+
+		h := s.snapStarts[val.Value]
+		if h == nil {
+			h = &valueHeap{}
+			s.snapStarts[val.Value] = h
+		}
+		if val.Delta > 0 {
+			heap.Push(h, val.OriginalT)
+		} else {
+			h.Retire(val.OriginalT)
+		}
+
+		isActive := s.snapDepth[val.Value] > 0
+		if isActive != wasActive {
+			if isActive {
+				s.snapActive = append(s.snapActive, val.Value)
+			} else {
+				for j, v := range s.snapActive {
+					if v == val.Value {
+						s.snapActive = append(s.snapActive[:j], s.snapActive[j+1:]...)
+						break
+					}
+				}
+			}
+		}
+
+		snap := spanSnapshot[T]{active: append([]T(nil), s.snapActive...)}
+		if len(s.snapActive) > 0 {
+			snap.earliest = make(map[T]int64, len(s.snapActive))
+			for _, v := range s.snapActive {
+				snap.earliest[v] = s.snapStarts[v].Min()
+			}
+		}
+		s.snapshots = append(s.snapshots, snap)
+	}
+}
+
+// SetSpan marks value as active for [start, end) -- start is inclusive, end
+// is exclusive, matching the iterator's own [Start(), End()) window.
+//
+// A zero end time indicates an open-ended span (e.g. a current shift pulled
+// from history); it is clipped to the iterator's End(). Spans outside the
+// window ([Start(), End())) are dropped entirely, and spans that cross a
+// window boundary are clamped to it. SetSpan(t, t, ...) -- or any span that
+// clamps down to zero length -- is a no-op.
+//
+// Spans may overlap, including with other spans for the same value; value is
+// active for as long as at least one of its spans is open.
+func (s *SpanCalculator[T]) SetSpan(start, end time.Time, value T) {
+	if s.init {
+		panic("cannot add spans after Init")
+	}
+
+	// OriginalT should reflect the span's real start, even if it gets
+	// clamped below, so capture it before clamping.
+	origStart := start.Truncate(s.Step()).Unix()
+
+	if end.IsZero() {
+		end = s.End()
+	}
+
+	// Drop spans with no overlap with [Start(), End()) at all.
+	if !end.After(s.Start()) || !start.Before(s.End()) {
+		return
+	}
+
+	if start.Before(s.Start()) {
+		start = s.Start()
+	}
+	if end.After(s.End()) {
+		end = s.End()
+	}
+
+	// Drop spans that clamp down to zero (or negative) length.
+	if !end.After(start) {
+		return
+	}
+
+	s.push(start, 1, origStart, value)
+	s.push(end, -1, origStart, value)
+}
+
+// AppendSpan inserts a new span, same as SetSpan, but is legal to call after
+// Init -- for streaming/live ingestion use cases such as a long-horizon
+// on-call report that wants to feed in newly-discovered override spans as
+// the rules engine computes them, without buffering the whole history first.
+//
+// Unlike SetSpan, it only accepts spans entirely after the iterator's current
+// position (Unix()); an attempt to insert a span at or before the current
+// tick returns an error rather than silently corrupting already-processed
+// state.
+func (s *SpanCalculator[T]) AppendSpan(start, end time.Time, value T) error {
+	if !s.init {
+		panic("Init must be called before AppendSpan")
+	}
+
+	origStart := start.Truncate(s.Step()).Unix()
+
+	if end.IsZero() {
+		end = s.End()
+	}
+
+	// Drop spans with no overlap with [Start(), End()) at all.
+	if !end.After(s.Start()) || !start.Before(s.End()) {
+		return nil
+	}
+
+	if start.Before(s.Start()) {
+		start = s.Start()
+	}
+	if end.After(s.End()) {
+		end = s.End()
+	}
+
+	// Drop spans that clamp down to zero (or negative) length.
+	if !end.After(start) {
+		return nil
+	}
+
+	startID := start.Truncate(s.Step()).Unix()
+	endID := end.Truncate(s.Step()).Unix()
+	if startID <= s.Unix() || endID <= s.Unix() {
+		return fmt.Errorf("oncall: span start/end must be strictly after the current iterator position")
+	}
+
+	before := len(s.states)
+	i := s.insert(spanEvent[T]{T: startID, Delta: 1, Value: value, OriginalT: origStart})
+	s.insert(spanEvent[T]{T: endID, Delta: -1, Value: value, OriginalT: origStart})
+
+	if i == before {
+		// Both new events landed after every already-snapshotted event --
+		// the common case, since spans are expected to arrive in roughly
+		// chronological order -- so just extend the snapshot tail instead
+		// of paying for a full rebuild.
+		s.extendSnapshots(before)
+	} else {
+		// An out-of-order append landed before already-snapshotted future
+		// events; correctness requires recomputing everything from there
+		// on, so fall back to a full rebuild.
+		s.rebuildSnapshots()
+	}
+
+	// The parent TimeIterator may have already committed to a later
+	// nextStep (e.g. jumped straight to End() because, as of the last
+	// Next() call, nothing else was pending) before this span arrived.
+	// Pull that hint back in so the new start isn't skipped over.
+	if s.nextStep == 0 || startID < s.nextStep {
+		s.nextStep = startID
+	}
+
+	return nil
+}
+
+// insert adds ev to states, preserving sort order by T, and returns the
+// index it was inserted at.
+func (s *SpanCalculator[T]) insert(ev spanEvent[T]) int {
+	i := sort.Search(len(s.states), func(i int) bool { return s.states[i].T > ev.T })
+
+	s.states = append(s.states, spanEvent[T]{})
+	copy(s.states[i+1:], s.states[i:])
+	s.states[i] = ev
+
+	return i
+}
+
+func (s *SpanCalculator[T]) push(t time.Time, delta int, originalStart int64, value T) {
+	id := t.Truncate(s.Step()).Unix()
+
+	s.states = append(s.states, spanEvent[T]{T: id, Delta: delta, Value: value, OriginalT: originalStart})
+}
+
+// Process implements the SubIterator.Process method.
+func (s *SpanCalculator[T]) Process(t int64) int64 {
+	if !s.init {
+		panic("Init never called")
+	}
+
+	s.changed = false
+
+	// wasActive/touched record each touched value's active state from
+	// before this tick's events are applied, once per value (on first
+	// touch) -- so that multiple events for the same value in one tick
+	// (e.g. one span closing and another, touching, span opening) net out
+	// correctly instead of reporting a spurious Changed() for the
+	// momentary zero-crossing in between.
+	var wasActive map[T]bool
+	var touched []T
+	for s.pos < len(s.states) && s.states[s.pos].T == t {
+		val := s.states[s.pos]
+		s.pos++
+
+		if wasActive == nil {
+			wasActive = make(map[T]bool)
+		}
+		if _, ok := wasActive[val.Value]; !ok {
+			wasActive[val.Value] = s.depth[val.Value] > 0
+			touched = append(touched, val.Value)
+		}
+		s.depth[val.Value] += val.Delta
+
+		h := s.starts[val.Value]
+		if h == nil {
+			h = &valueHeap{}
+			s.starts[val.Value] = h
+		}
+		if val.Delta > 0 {
+			heap.Push(h, val.OriginalT)
+		} else {
+			h.Retire(val.OriginalT)
+		}
+	}
+
+	for _, value := range touched {
+		isActive := s.depth[value] > 0
+		if isActive == wasActive[value] {
+			continue
+		}
+		s.changed = true
+		if isActive {
+			s.active = append(s.active, value)
+			continue
+		}
+		for i, v := range s.active {
+			if v == value {
+				s.active = append(s.active[:i], s.active[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if s.pos >= len(s.states) {
+		return -1
+	}
+
+	return s.states[s.pos].T
+}
+
+// Done implements the SubIterator.Done method.
+func (s *SpanCalculator[T]) Done() {
+	//lint:ignore SA6002 not worth the overhead to avoid the slice-struct allocation
+	spanEventPool[T]().Put(s.states[:0])
+	//lint:ignore SA6002 not worth the overhead to avoid the slice-struct allocation
+	activeValuePool[T]().Put(s.active[:0])
+
+	s.states = nil
+	s.depth = nil
+	s.starts = nil
+	s.active = nil
+	s.snapshots = nil
+	s.snapDepth = nil
+	s.snapStarts = nil
+	s.snapActive = nil
+}
+
+// ActiveValues returns the set of values active for the current timestamp, in
+// the order they became active.
+func (s *SpanCalculator[T]) ActiveValues() []T { return s.active }
+
+// Changed will return true if the current tick changed the ActiveValues() result.
+func (s *SpanCalculator[T]) Changed() bool { return s.changed }
+
+// ActiveTime returns the earliest still-open start time for value.
+//
+// If value is not currently active, it returns a zero value.
+func (s *SpanCalculator[T]) ActiveTime(value T) time.Time {
+	if s.depth[value] <= 0 {
+		return time.Time{}
+	}
+
+	h := s.starts[value]
+	if h == nil {
+		return time.Time{}
+	}
+
+	return time.Unix(h.Min(), 0).UTC()
+}
+
+// snapshotAt returns the index into states/snapshots for the last event at
+// or before id, via sort.Search -- or -1 if there is none.
+func (s *SpanCalculator[T]) snapshotAt(id int64) int {
+	return sort.Search(len(s.states), func(i int) bool { return s.states[i].T > id }) - 1
+}
+
+// ActiveValuesAt returns the set of values active at t, without requiring the
+// caller to step a TimeIterator up to that point. It is an O(log n)
+// random-access query against the (already Init'd) snapshots built by Init
+// (and kept up to date by AppendSpan).
+func (s *SpanCalculator[T]) ActiveValuesAt(t time.Time) []T {
+	if !s.init {
+		panic("Init never called")
+	}
+
+	i := s.snapshotAt(t.Truncate(s.Step()).Unix())
+	if i < 0 {
+		return nil
+	}
+
+	return s.snapshots[i].active
+}
+
+// ActiveTimeAt returns the earliest still-open start time for value at t.
+//
+// If value was not active at t, it returns a zero value.
+func (s *SpanCalculator[T]) ActiveTimeAt(t time.Time, value T) time.Time {
+	if !s.init {
+		panic("Init never called")
+	}
+
+	i := s.snapshotAt(t.Truncate(s.Step()).Unix())
+	if i < 0 {
+		return time.Time{}
+	}
+
+	ts, ok := s.snapshots[i].earliest[value]
+	if !ok {
+		return time.Time{}
+	}
+
+	return time.Unix(ts, 0).UTC()
+}
+
+// valueHeap is a min-heap of currently open span start times, supporting lazy
+// deletion so that the earliest open start can be found in O(log n) even
+// though the span that closes isn't necessarily the one that opened most
+// recently.
+type valueHeap struct {
+	h       []int64
+	retired map[int64]int
+}
+
+func (s *valueHeap) Len() int           { return len(s.h) }
+func (s *valueHeap) Less(i, j int) bool { return s.h[i] < s.h[j] }
+func (s *valueHeap) Swap(i, j int)      { s.h[i], s.h[j] = s.h[j], s.h[i] }
+
+func (s *valueHeap) Push(x interface{}) { s.h = append(s.h, x.(int64)) }
+func (s *valueHeap) Pop() interface{} {
+	old := s.h
+	n := len(old)
+	v := old[n-1]
+	s.h = old[:n-1]
+	return v
+}
+
+// Retire marks one occurrence of t as no longer open; it is skipped (and
+// dropped) the next time Min is called.
+func (s *valueHeap) Retire(t int64) {
+	if s.retired == nil {
+		s.retired = make(map[int64]int)
+	}
+	s.retired[t]++
+}
+
+// Min returns the earliest still-open start time, discarding any retired
+// entries it encounters along the way.
+func (s *valueHeap) Min() int64 {
+	for len(s.h) > 0 {
+		t := s.h[0]
+		if s.retired[t] > 0 {
+			s.retired[t]--
+			heap.Pop(s)
+			continue
+		}
+		return t
+	}
+
+	return 0
+}
@@ -0,0 +1,12 @@
+package oncall
+
+// UserCalculator will calculate the set of users with an open span for the
+// current timestamp.
+//
+// It is a SpanCalculator of user IDs; see SpanCalculator for semantics.
+type UserCalculator = SpanCalculator[string]
+
+// NewUserCalculator will create a new UserCalculator bound to the TimeIterator.
+func (t *TimeIterator) NewUserCalculator() *UserCalculator {
+	return newSpanCalculator[string](t)
+}
@@ -44,7 +44,7 @@ func TestUserCalculator(t *testing.T) {
 			for iter.Next() {
 				results = append(results, result{
 					Time:  time.Unix(iter.Unix(), 0).UTC(),
-					Value: cloneSlice(iter.ActiveUsers()),
+					Value: cloneSlice(iter.ActiveValues()),
 				})
 			}
 
@@ -97,3 +97,116 @@ func TestUserCalculator(t *testing.T) {
 		},
 	)
 }
+
+// TestUserCalculator_AppendSpan covers inserting spans after Init, for the
+// streaming-ingestion use case.
+//
+// TimeIterator only ticks at times a registered sub-iterator actually cares
+// about (plus Start() and End()), so with a single one-minute span there are
+// only 3 ticks: Start() (span opens), Start()+1m (span closes), and End()
+// (nothing left pending, so the iterator jumps straight there).
+func TestUserCalculator_AppendSpan(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 10, 0, 0, time.UTC)
+	)
+	iter := oncall.NewTimeIterator(start, end, time.Minute).NewUserCalculator()
+	iter.SetSpan(start, start.Add(time.Minute), "foo")
+	iter.Init()
+
+	// Step up to the span's close tick before appending, to simulate a live
+	// "tail" use case where later spans are discovered as iteration
+	// proceeds.
+	assert.True(t, iter.Next())
+	assert.Equal(t, start.Unix(), iter.Unix())
+	assert.True(t, iter.Next())
+	assert.Equal(t, start.Add(time.Minute).Unix(), iter.Unix())
+
+	err := iter.AppendSpan(start, start.Add(2*time.Minute), "bar")
+	assert.Error(t, err, "span at/before the current position should be rejected")
+
+	err = iter.AppendSpan(start.Add(5*time.Minute), start.Add(6*time.Minute), "bar")
+	assert.NoError(t, err)
+
+	var results [][]string
+	for iter.Next() {
+		results = append(results, cloneSlice(iter.ActiveValues()))
+	}
+	assert.EqualValues(t, [][]string{{"bar"}, nil, nil}, results)
+}
+
+// TestUserCalculator_ActiveValuesAt covers point queries issued before
+// iteration starts, mid-iteration, and for an already-consumed past tick --
+// ActiveValuesAt must stay correct throughout, independent of how far
+// Process has advanced.
+func TestUserCalculator_ActiveValuesAt(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 10, 0, 0, time.UTC)
+	)
+	iter := oncall.NewTimeIterator(start, end, time.Minute).NewUserCalculator()
+	iter.SetSpan(start.Add(time.Minute), start.Add(2*time.Minute), "foo")
+	iter.SetSpan(start.Add(3*time.Minute), start.Add(4*time.Minute), "bar")
+	iter.SetSpan(start.Add(6*time.Minute), start.Add(8*time.Minute), "baz")
+	iter.Init()
+
+	future := start.Add(3*time.Minute + 30*time.Second)
+	past := start.Add(time.Minute + 30*time.Second)
+
+	assert.EqualValues(t, []string{"bar"}, iter.ActiveValuesAt(future), "before any Next()")
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, iter.Next())
+	}
+
+	assert.EqualValues(t, []string{"bar"}, iter.ActiveValuesAt(future), "mid-iteration, query still ahead of the current tick")
+	assert.EqualValues(t, []string{"foo"}, iter.ActiveValuesAt(past), "mid-iteration, query into the already-consumed past")
+}
+
+// TestUserCalculator_Changed_TouchingSpans covers two touching (but
+// non-overlapping) spans for the same value: at the tick where one ends and
+// the other begins, ActiveValues() is unchanged, so Changed() must report
+// false rather than flickering through a momentary zero-crossing.
+func TestUserCalculator_Changed_TouchingSpans(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 6, 0, 0, time.UTC)
+	)
+	iter := oncall.NewTimeIterator(start, end, time.Minute).NewUserCalculator()
+	iter.SetSpan(start, start.Add(2*time.Minute), "foo")
+	iter.SetSpan(start.Add(2*time.Minute), start.Add(4*time.Minute), "foo")
+	iter.Init()
+
+	var changed []bool
+	for iter.Next() {
+		changed = append(changed, iter.Changed())
+	}
+	assert.EqualValues(t, []bool{true, false, true, false}, changed)
+}
+
+// TestUserCalculator_AppendSpan_ActiveValuesAt covers ActiveValuesAt after
+// AppendSpan, both for a span appended strictly after everything seen so
+// far (the common tail-append case) and for one appended out of order
+// (landing before an already-appended future span).
+func TestUserCalculator_AppendSpan_ActiveValuesAt(t *testing.T) {
+	var (
+		start = time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC)
+		end   = time.Date(2000, 1, 2, 3, 20, 0, 0, time.UTC)
+	)
+	iter := oncall.NewTimeIterator(start, end, time.Minute).NewUserCalculator()
+	iter.SetSpan(start, start.Add(time.Minute), "foo")
+	iter.Init()
+
+	assert.True(t, iter.Next())
+	assert.True(t, iter.Next())
+	assert.Equal(t, start.Add(time.Minute).Unix(), iter.Unix())
+
+	// Tail append: nothing appended yet is later than this.
+	assert.NoError(t, iter.AppendSpan(start.Add(10*time.Minute), start.Add(11*time.Minute), "far"))
+	assert.EqualValues(t, []string{"far"}, iter.ActiveValuesAt(start.Add(10*time.Minute+30*time.Second)))
+
+	// Out-of-order append: lands before "far", already-snapshotted.
+	assert.NoError(t, iter.AppendSpan(start.Add(5*time.Minute), start.Add(6*time.Minute), "near"))
+	assert.EqualValues(t, []string{"near"}, iter.ActiveValuesAt(start.Add(5*time.Minute+30*time.Second)))
+	assert.EqualValues(t, []string{"far"}, iter.ActiveValuesAt(start.Add(10*time.Minute+30*time.Second)))
+}